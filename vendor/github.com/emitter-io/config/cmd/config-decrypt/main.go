@@ -0,0 +1,45 @@
+// Command config-decrypt opens a configuration file previously sealed with
+// config-encrypt, writing the plaintext back out. Combine the two to rotate
+// a key: decrypt with the old key, then encrypt with the new one.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/emitter-io/config"
+)
+
+func main() {
+	key := flag.String("key", os.Getenv("EMITTER_CONFIG_KEY"), "raw 32-byte hex key or passphrase")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: config-decrypt -key <key-or-passphrase> <in.enc> <out>")
+		os.Exit(1)
+	}
+
+	if *key == "" {
+		fmt.Fprintln(os.Stderr, "config-decrypt: no key provided, set -key or EMITTER_CONFIG_KEY")
+		os.Exit(1)
+	}
+
+	body, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config-decrypt:", err)
+		os.Exit(1)
+	}
+
+	opened, err := config.Open(body, *key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config-decrypt:", err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(flag.Arg(1), opened, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, "config-decrypt:", err)
+		os.Exit(1)
+	}
+}
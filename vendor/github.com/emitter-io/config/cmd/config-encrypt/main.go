@@ -0,0 +1,45 @@
+// Command config-encrypt seals a plaintext configuration file with AES-GCM so
+// it can be stored as a *.enc file. The key may be a raw 32-byte hex value or
+// a passphrase, and defaults to the EMITTER_CONFIG_KEY environment variable.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/emitter-io/config"
+)
+
+func main() {
+	key := flag.String("key", os.Getenv("EMITTER_CONFIG_KEY"), "raw 32-byte hex key or passphrase")
+	flag.Parse()
+
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "usage: config-encrypt -key <key-or-passphrase> <in> <out.enc>")
+		os.Exit(1)
+	}
+
+	if *key == "" {
+		fmt.Fprintln(os.Stderr, "config-encrypt: no key provided, set -key or EMITTER_CONFIG_KEY")
+		os.Exit(1)
+	}
+
+	body, err := ioutil.ReadFile(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config-encrypt:", err)
+		os.Exit(1)
+	}
+
+	sealed, err := config.Seal(body, *key)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "config-encrypt:", err)
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(flag.Arg(1), sealed, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, "config-encrypt:", err)
+		os.Exit(1)
+	}
+}
@@ -13,8 +13,35 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
 )
 
+// format represents a supported configuration file format.
+type format int
+
+// The supported configuration file formats.
+const (
+	formatJSON format = iota
+	formatYAML
+	formatTOML
+)
+
+// formatOf determines the configuration format from a file path's extension,
+// defaulting to JSON when the extension is unrecognized.
+func formatOf(path string) format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".toml":
+		return formatTOML
+	default:
+		return formatJSON
+	}
+}
+
 // SecretStore represents a contract for a store capable of resolving secrets.
 type SecretStore interface {
 	Configure(config Config) error
@@ -34,9 +61,9 @@ type Config interface {
 
 // TLSConfig represents TLS listener configuration.
 type TLSConfig struct {
-	ListenAddr  string `json:"listen"`      // The address to listen on.
-	Certificate string `json:"certificate"` // The certificate request.
-	PrivateKey  string `json:"private"`     // The private key for the certificate.
+	ListenAddr  string `json:"listen" yaml:"listen" toml:"listen"`                // The address to listen on.
+	Certificate string `json:"certificate" yaml:"certificate" toml:"certificate"` // The certificate request.
+	PrivateKey  string `json:"private" yaml:"private" toml:"private"`             // The private key for the certificate.
 }
 
 // Load loads a certificate from the configuration.
@@ -69,8 +96,20 @@ func (c *TLSConfig) Load() tls.Certificate {
 
 // VaultConfig represents Vault configuration.
 type VaultConfig struct {
-	Address     string `json:"address"` // The vault address to use.
-	Application string `json:"app"`     // The vault application ID to use.
+	Address     string `json:"address" yaml:"address" toml:"address"` // The vault address to use.
+	Application string `json:"app" yaml:"app" toml:"app"`             // The vault application ID to use.
+}
+
+// vaultStoreFactory builds the default Vault-backed SecretStore. It is set by the
+// github.com/emitter-io/config/vault package's init() so that this package does not
+// need to depend on it directly.
+var vaultStoreFactory func(*VaultConfig) SecretStore
+
+// RegisterVaultStore registers the factory used to build the default Vault-backed
+// SecretStore for a non-empty VaultConfig. This is called by the vault subpackage
+// and should not normally be called directly.
+func RegisterVaultStore(factory func(*VaultConfig) SecretStore) {
+	vaultStoreFactory = factory
 }
 
 // ProviderConfig represents provider configuration.
@@ -78,14 +117,40 @@ type ProviderConfig struct {
 
 	// The storage provider, this can either be specific builtin or a name of the symbol in
 	// the plugin specified by the plugin path.
-	Provider string `json:"provider"`
+	Provider string `json:"provider" yaml:"provider" toml:"provider"`
 
 	// The plugin path specifies the location of the plugin which contains the provider.
-	PluginPath string `json:"plugin,omitempty"`
+	PluginPath string `json:"plugin,omitempty" yaml:"plugin,omitempty" toml:"plugin,omitempty"`
 
 	// The configuration for a provider. This specifies various parameters to provide to the
 	// specific provider during the Configure() call.
-	Config map[string]interface{} `json:"config,omitempty"`
+	Config map[string]interface{} `json:"config,omitempty" yaml:"config,omitempty" toml:"config,omitempty"`
+
+	// state holds the cached builder and the currently built provider. It's a
+	// single pointer indirection, rather than an embedded sync.Mutex, so that
+	// a ProviderConfig (e.g. a field copied out of a larger Config) remains
+	// safe to pass and copy by value.
+	state *providerState
+}
+
+// providerState is the mutable, lazily-allocated half of a ProviderConfig.
+type providerState struct {
+	mu      sync.Mutex
+	builder ProviderBuilder
+	current Provider
+}
+
+// stateMu guards the lazy allocation of a ProviderConfig's state.
+var stateMu sync.Mutex
+
+// ensureState returns c's lazily-allocated state, allocating it on first use.
+func (c *ProviderConfig) ensureState() *providerState {
+	stateMu.Lock()
+	defer stateMu.Unlock()
+	if c.state == nil {
+		c.state = &providerState{}
+	}
+	return c.state
 }
 
 // LoadOrPanic loads a provider from the configuration and uses one or several builtins
@@ -148,22 +213,22 @@ type ClusterConfig struct {
 
 	// The name of this node. This must be unique in the cluster. If this is not set, Emitter
 	// will set it to the external IP address of the running machine.
-	NodeName string `json:"name,omitempty"`
+	NodeName string `json:"name,omitempty" yaml:"name,omitempty" toml:"name,omitempty"`
 
 	// The IP address and port that is used to bind the inter-node communication network. This
 	// is used for the actual binding of the port.
-	ListenAddr string `json:"listen"`
+	ListenAddr string `json:"listen" yaml:"listen" toml:"listen"`
 
 	// The address and port to advertise inter-node communication network. This is used for nat
 	// traversal.
-	AdvertiseAddr string `json:"advertise"`
+	AdvertiseAddr string `json:"advertise" yaml:"advertise" toml:"advertise"`
 
 	// The seed address (or a domain name) for cluster join.
-	Seed string `json:"seed"`
+	Seed string `json:"seed" yaml:"seed" toml:"seed"`
 
 	// Passphrase is used to initialize the primary encryption key in a keyring. This key
 	// is used for encrypting all the gossip messages (message-level encryption).
-	Passphrase string `json:"passphrase,omitempty"`
+	Passphrase string `json:"passphrase,omitempty" yaml:"passphrase,omitempty" toml:"passphrase,omitempty"`
 }
 
 // LoadProvider loads a provider from the configuration or panics if the configuration is
@@ -178,44 +243,94 @@ func LoadProvider(config *ProviderConfig, providers ...Provider) Provider {
 	return config.LoadOrPanic(providers...)
 }
 
-// Write writes the configuration to a specific writer, in JSON format.
-func write(config interface{}, output io.Writer) (int, error) {
-	var formatted bytes.Buffer
-	body, err := json.Marshal(config)
-	if err != nil {
-		return 0, err
-	}
+// Write writes the configuration to a specific writer, using the given format.
+func write(config interface{}, output io.Writer, f format) (int, error) {
+	switch f {
+	case formatYAML:
+		body, err := yaml.Marshal(config)
+		if err != nil {
+			return 0, err
+		}
+		return output.Write(body)
+
+	case formatTOML:
+		var formatted bytes.Buffer
+		if err := toml.NewEncoder(&formatted).Encode(config); err != nil {
+			return 0, err
+		}
+		return output.Write(formatted.Bytes())
+
+	default:
+		var formatted bytes.Buffer
+		body, err := json.Marshal(config)
+		if err != nil {
+			return 0, err
+		}
 
-	if err := json.Indent(&formatted, body, "", "\t"); err != nil {
-		return 0, err
+		if err := json.Indent(&formatted, body, "", "\t"); err != nil {
+			return 0, err
+		}
+
+		return output.Write(formatted.Bytes())
 	}
+}
 
-	return output.Write(formatted.Bytes())
+// unmarshal decodes a configuration payload using the given format.
+func unmarshal(b []byte, cfg interface{}, f format) error {
+	switch f {
+	case formatYAML:
+		return yaml.Unmarshal(b, cfg)
+	case formatTOML:
+		return toml.Unmarshal(b, cfg)
+	default:
+		return json.Unmarshal(b, cfg)
+	}
 }
 
 // createDefault writes the default configuration to disk.
-func createDefault(path string, newDefault func() Config) (Config, error) {
-	f, err := os.OpenFile(path, os.O_CREATE, os.ModePerm)
-	if err != nil {
+func createDefault(path string, newDefault func() Config, f format) (Config, error) {
+	c := newDefault()
+	var body bytes.Buffer
+	if _, err := write(c, &body, f); err != nil {
 		return nil, err
 	}
 
-	defer f.Close()
-	c := newDefault()
-	if _, err := write(c, f); err != nil {
-		return nil, err
+	out := body.Bytes()
+	if isEncryptedPath(path) {
+		key, err := loadEncryptionKey()
+		if err != nil {
+			return nil, err
+		}
+		if out, err = Seal(out, key); err != nil {
+			return nil, err
+		}
 	}
-	if err := f.Sync(); err != nil {
+
+	if err := ioutil.WriteFile(path, out, os.ModePerm); err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
-// ReadOrCreate reads or creates the configuration object.
+// ReadOrCreate reads or creates the configuration object. The format (JSON, YAML
+// or TOML) is determined from the extension of path.
 func ReadOrCreate(prefix string, path string, newDefault func() Config, stores ...SecretStore) (cfg Config, err error) {
+	return readOrCreate(prefix, path, newDefault, nil, stores...)
+}
+
+// ReadOrCreateWithResolvers is like ReadOrCreate, but additionally consults
+// resolvers per-field, before the stores, whenever a field's current value
+// is already a scheme URI (see SchemeResolver).
+func ReadOrCreateWithResolvers(prefix string, path string, newDefault func() Config, resolvers []SchemeResolver, stores ...SecretStore) (cfg Config, err error) {
+	return readOrCreate(prefix, path, newDefault, resolvers, stores...)
+}
+
+func readOrCreate(prefix string, path string, newDefault func() Config, resolvers []SchemeResolver, stores ...SecretStore) (cfg Config, err error) {
+	f := formatOf(path)
+
 	if _, err := os.Stat(path); os.IsNotExist(err) {
 		// Create a configuration and write it to a file
-		if cfg, err = createDefault(path, newDefault); err != nil {
+		if cfg, err = createDefault(path, newDefault, f); err != nil {
 			return nil, err
 		}
 	} else {
@@ -225,41 +340,108 @@ func ReadOrCreate(prefix string, path string, newDefault func() Config, stores .
 			return nil, err
 		}
 
+		// If the file was sealed with Seal, open it before unmarshaling. This is
+		// decided from the file's own header, not just the path or environment,
+		// so a plaintext file is never mistaken for ciphertext merely because a
+		// key happens to be configured.
+		if isSealed(b) {
+			key, err := loadEncryptionKey()
+			if err != nil {
+				return nil, err
+			}
+			if b, err = Open(b, key); err != nil {
+				return nil, err
+			}
+		}
+
 		// Unmarshal the configuration
-		if err := json.Unmarshal(b, cfg); err != nil {
+		cfg = newDefault()
+		if err := unmarshal(b, cfg, f); err != nil {
 			return nil, err
 		}
 	}
 
+	// If the configuration has a Vault address configured, wire up the default
+	// Vault store automatically, after any stores passed explicitly.
+	if vc := cfg.Vault(); vc != nil && vc.Address != "" && vaultStoreFactory != nil {
+		stores = append(stores, vaultStoreFactory(vc))
+	}
+
+	// Combine the globally registered resolvers with any passed explicitly,
+	// the latter taking precedence for a given scheme.
+	resolved := make(map[string]SchemeResolver, len(schemeResolvers)+len(resolvers))
+	for scheme, r := range schemeResolvers {
+		resolved[scheme] = r
+	}
+	for _, r := range resolvers {
+		resolved[r.Scheme()] = r
+	}
+
+	// Scheme resolution happens as part of the same recursive walk as the
+	// stores, so make sure the walk runs at least once even if no stores
+	// were configured.
+	if len(stores) == 0 && len(resolved) > 0 {
+		stores = append(stores, noopStore{})
+	}
+
 	// Apply all the store overrides, in order
 	for _, store := range stores {
 		if err := store.Configure(cfg); err == nil {
-			declassify(cfg, prefix, store)
+			declassify(cfg, prefix, f, resolved, store)
+		}
+	}
+
+	// Opt-in: auto-provision a self-signed TLS certificate and a stable
+	// cluster node identity on first boot.
+	if autoProvisionEnabled() {
+		if tp, ok := cfg.(tlsProvisioner); ok {
+			if tc := tp.TLS(); tc != nil {
+				cert, err := tc.LoadOrCreate()
+				if err != nil {
+					return nil, err
+				}
+
+				if cp, ok := cfg.(clusterProvisioner); ok {
+					if cc := cp.Cluster(); cc != nil {
+						if err := cc.EnsureIdentity(cert, filepath.Dir(path)); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
 		}
 	}
 
 	return cfg, nil
 }
 
+// noopStore is a SecretStore that never resolves anything. It's used to make
+// sure the declassification walk still runs when resolvers are configured
+// but no actual secret stores are.
+type noopStore struct{}
+
+func (noopStore) Configure(Config) error          { return nil }
+func (noopStore) GetSecret(string) (string, bool) { return "", false }
+
 // Declassify traverses the configuration and resolves secrets.
-func declassify(config interface{}, prefix string, provider SecretStore) {
+func declassify(config interface{}, prefix string, f format, resolvers map[string]SchemeResolver, provider SecretStore) {
 	original := reflect.ValueOf(config)
-	declassifyRecursive(prefix, provider, original)
+	declassifyRecursive(prefix, f, resolvers, provider, original)
 }
 
 // DeclassifyRecursive traverses the configuration and resolves secrets.
-func declassifyRecursive(prefix string, provider SecretStore, value reflect.Value) {
+func declassifyRecursive(prefix string, f format, resolvers map[string]SchemeResolver, provider SecretStore, value reflect.Value) {
 	switch value.Kind() {
 	case reflect.Ptr:
 		if value.Elem().IsValid() {
-			declassifyRecursive(prefix, provider, value.Elem())
+			declassifyRecursive(prefix, f, resolvers, provider, value.Elem())
 		}
 
 	// If it is a struct we translate each field
 	case reflect.Struct:
 		for i := 0; i < value.NumField(); i++ {
-			name := getFieldName(value.Type().Field(i))
-			declassifyRecursive(prefix+"/"+name, provider, value.Field(i))
+			name := getFieldName(value.Type().Field(i), f)
+			declassifyRecursive(prefix+"/"+name, f, resolvers, provider, value.Field(i))
 		}
 
 	// This is a integer, we need to fetch the secret
@@ -270,14 +452,46 @@ func declassifyRecursive(prefix string, provider SecretStore, value reflect.Valu
 			}
 		}
 
-	// This is a string, we need to fetch the secret
+	// This is a string: if its current value is a scheme URI, resolve it
+	// through the matching SchemeResolver; otherwise fetch the secret.
 	case reflect.String:
+		if scheme := schemeOf(value.String()); scheme != "" {
+			if r, ok := resolvers[scheme]; ok {
+				if v, found, err := r.Resolve(value.String()); err == nil && found {
+					value.SetString(v)
+					return
+				}
+			}
+		}
+
 		if v, ok := provider.GetSecret(prefix); ok {
 			value.SetString(v)
 		}
 	}
 }
 
-func getFieldName(f reflect.StructField) string {
-	return strings.Replace(string(f.Tag.Get("json")), ",omitempty", "", -1)
-}
\ No newline at end of file
+// getFieldName returns the serialized name of a struct field, preferring the tag
+// that matches the configuration format in use so that secret paths remain
+// stable regardless of which file format the broker is configured with.
+func getFieldName(f reflect.StructField, cfgFormat format) string {
+	tag := "json"
+	switch cfgFormat {
+	case formatYAML:
+		tag = "yaml"
+	case formatTOML:
+		tag = "toml"
+	}
+
+	if name := fieldTag(f, tag); name != "" {
+		return name
+	}
+
+	// Fall back to the JSON tag, since that's what every struct in this
+	// package is guaranteed to declare.
+	return fieldTag(f, "json")
+}
+
+func fieldTag(f reflect.StructField, tag string) string {
+	name := strings.Split(f.Tag.Get(tag), ",")[0]
+	return name
+}
@@ -0,0 +1,71 @@
+package config
+
+import "testing"
+
+// TestSealOpenKeyRotation seals a payload under one raw 32-byte hex key,
+// then confirms the old key can still open it while a new key cannot -
+// simulating the re-seal-with-a-new-key workflow used to rotate
+// EMITTER_CONFIG_KEY. Both keys are 64 hex chars so Seal takes the
+// keyMethodRaw path rather than falling back to scrypt.
+func TestSealOpenKeyRotation(t *testing.T) {
+	oldKey := "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+	newKey := "202122232425262728292a2b2c2d2e2f303132333435363738393a3b3c3d3e3f"
+	body := []byte(`{"listen":":8080"}`)
+
+	sealed, err := Seal(body, oldKey)
+	if err != nil {
+		t.Fatalf("seal with old key: %v", err)
+	}
+
+	opened, err := Open(sealed, oldKey)
+	if err != nil {
+		t.Fatalf("open with old key: %v", err)
+	}
+	if string(opened) != string(body) {
+		t.Fatalf("open with old key: got %q, want %q", opened, body)
+	}
+
+	if _, err := Open(sealed, newKey); err == nil {
+		t.Fatal("open with new key succeeded, want failure before rotation")
+	}
+
+	rotated, err := Seal(opened, newKey)
+	if err != nil {
+		t.Fatalf("re-seal with new key: %v", err)
+	}
+
+	reopened, err := Open(rotated, newKey)
+	if err != nil {
+		t.Fatalf("open with new key after rotation: %v", err)
+	}
+	if string(reopened) != string(body) {
+		t.Fatalf("open after rotation: got %q, want %q", reopened, body)
+	}
+
+	if _, err := Open(rotated, oldKey); err == nil {
+		t.Fatal("open with old key succeeded, want failure after rotation")
+	}
+}
+
+// TestSealOpenPassphrase covers the scrypt-derived key path, used when the
+// configured key material isn't a raw 32-byte hex key.
+func TestSealOpenPassphrase(t *testing.T) {
+	body := []byte(`{"listen":":8080"}`)
+
+	sealed, err := Seal(body, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	opened, err := Open(sealed, "correct horse battery staple")
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if string(opened) != string(body) {
+		t.Fatalf("open: got %q, want %q", opened, body)
+	}
+
+	if _, err := Open(sealed, "wrong passphrase"); err == nil {
+		t.Fatal("open with wrong passphrase succeeded, want failure")
+	}
+}
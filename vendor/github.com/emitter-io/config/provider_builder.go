@@ -0,0 +1,135 @@
+package config
+
+import (
+	"errors"
+	"plugin"
+)
+
+// StableConfig is an opaque, builder-specific value produced by
+// ProviderBuilder.ParseConfig and handed back to Build on every (re)load,
+// including a subsequent Reload.
+type StableConfig interface{}
+
+// ProviderBuilder builds Provider instances from a plugin. Unlike a plain
+// Provider, a builder is looked up from the plugin only once; ProviderConfig
+// caches it so Reload can re-parse the configuration and construct a fresh
+// Provider without reopening the plugin.
+type ProviderBuilder interface {
+	Name() string
+	ParseConfig(config map[string]interface{}) (StableConfig, error)
+	Build(config StableConfig) (Provider, error)
+}
+
+// Closer is implemented by providers that hold resources - connections,
+// file handles, background goroutines - which must be released when the
+// provider is replaced by Reload.
+type Closer interface {
+	Close() error
+}
+
+// loadBuilder opens the configured plugin and caches its ProviderBuilder,
+// returning the cached one on subsequent calls.
+func (c *ProviderConfig) loadBuilder() (ProviderBuilder, error) {
+	state := c.ensureState()
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if state.builder != nil {
+		return state.builder, nil
+	}
+
+	if c.PluginPath == "" {
+		return nil, errors.New("config: no plugin path configured for provider '" + c.Provider + "'")
+	}
+
+	p, err := plugin.Open(c.PluginPath)
+	if err != nil {
+		return nil, errors.New("The provider plugin path '" + c.PluginPath + "' could not be opened")
+	}
+
+	sym, err := p.Lookup(c.Provider)
+	if err != nil {
+		return nil, errors.New("The provider '" + c.Provider + "' could not be found in '" + c.PluginPath + "' location")
+	}
+
+	builder, valid := sym.(ProviderBuilder)
+	if !valid {
+		return nil, errors.New("The provider '" + c.Provider + "' does not implement ProviderBuilder interface")
+	}
+
+	state.builder = builder
+	return builder, nil
+}
+
+// LoadOrBuild loads a provider from the configuration, building it through a
+// cached ProviderBuilder when a plugin path is configured, or falling back
+// to one of the given builtins otherwise. Unlike Load, a plugin provider
+// loaded this way can later be swapped out with Reload; a builtin cannot,
+// since no builder is cached for it.
+func (c *ProviderConfig) LoadOrBuild(builtins ...Provider) (Provider, error) {
+	if c.PluginPath == "" {
+		return c.Load(builtins...)
+	}
+
+	builder, err := c.loadBuilder()
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := builder.ParseConfig(c.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := builder.Build(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	state := c.ensureState()
+	state.mu.Lock()
+	state.current = provider
+	state.mu.Unlock()
+	return provider, nil
+}
+
+// Reload re-parses the provider configuration and builds a fresh Provider
+// from the cached ProviderBuilder. The previous provider, if it implements
+// Closer, is only closed once the new one has been built successfully, so a
+// failed reload leaves the old provider running.
+//
+// c.Config is snapshotted under state.mu before parsing, since a
+// ProviderRegistry can overwrite it from a watcher goroutine concurrently
+// with a manual Reload call.
+func (c *ProviderConfig) Reload() (Provider, error) {
+	state := c.ensureState()
+
+	state.mu.Lock()
+	builder := state.builder
+	previous := state.current
+	cfg := c.Config
+	state.mu.Unlock()
+
+	if builder == nil {
+		return nil, errors.New("config: provider '" + c.Provider + "' has not been loaded yet")
+	}
+
+	parsed, err := builder.ParseConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	next, err := builder.Build(parsed)
+	if err != nil {
+		return nil, err
+	}
+
+	state.mu.Lock()
+	state.current = next
+	state.mu.Unlock()
+
+	if closer, ok := previous.(Closer); ok && previous != nil {
+		closer.Close()
+	}
+	return next, nil
+}
@@ -0,0 +1,115 @@
+package config
+
+import "testing"
+
+// closeTrackingProvider appends to a shared order slice when closed, and
+// fakeBuilder appends to the same slice when it builds one, so tests can
+// assert the relative ordering across providers.
+type closeTrackingProvider struct {
+	name  string
+	order *[]string
+}
+
+func (p *closeTrackingProvider) Name() string                           { return p.name }
+func (p *closeTrackingProvider) Configure(map[string]interface{}) error { return nil }
+func (p *closeTrackingProvider) Close() error {
+	*p.order = append(*p.order, "close:"+p.name)
+	return nil
+}
+
+// fakeBuilder is a ProviderBuilder whose Build call is recorded, and whose
+// failure can be toggled to exercise Reload's error path.
+type fakeBuilder struct {
+	order   *[]string
+	fail    bool
+	nextGen int
+}
+
+func (b *fakeBuilder) Name() string { return "fake" }
+
+func (b *fakeBuilder) ParseConfig(config map[string]interface{}) (StableConfig, error) {
+	return config, nil
+}
+
+func (b *fakeBuilder) Build(config StableConfig) (Provider, error) {
+	if b.fail {
+		return nil, errBuildFailed
+	}
+	b.nextGen++
+	name := "gen" + string(rune('0'+b.nextGen))
+	*b.order = append(*b.order, "build:"+name)
+	return &closeTrackingProvider{name: name, order: b.order}, nil
+}
+
+var errBuildFailed = errTest("build failed")
+
+type errTest string
+
+func (e errTest) Error() string { return string(e) }
+
+func TestReloadClosesPreviousOnlyAfterNewIsReady(t *testing.T) {
+	var order []string
+	builder := &fakeBuilder{order: &order}
+
+	c := &ProviderConfig{Provider: "fake", PluginPath: "unused"}
+	state := c.ensureState()
+	state.builder = builder
+
+	first, err := c.Reload()
+	if err != nil {
+		t.Fatalf("first reload: %v", err)
+	}
+	if first.Name() != "gen1" {
+		t.Fatalf("first reload: got %q, want gen1", first.Name())
+	}
+
+	second, err := c.Reload()
+	if err != nil {
+		t.Fatalf("second reload: %v", err)
+	}
+	if second.Name() != "gen2" {
+		t.Fatalf("second reload: got %q, want gen2", second.Name())
+	}
+
+	want := []string{"build:gen1", "build:gen2", "close:gen1"}
+	if len(order) != len(want) {
+		t.Fatalf("order: got %v, want %v", order, want)
+	}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order: got %v, want %v", order, want)
+		}
+	}
+}
+
+func TestReloadLeavesPreviousRunningOnFailure(t *testing.T) {
+	var order []string
+	builder := &fakeBuilder{order: &order}
+
+	c := &ProviderConfig{Provider: "fake", PluginPath: "unused"}
+	state := c.ensureState()
+	state.builder = builder
+
+	first, err := c.Reload()
+	if err != nil {
+		t.Fatalf("first reload: %v", err)
+	}
+
+	builder.fail = true
+	if _, err := c.Reload(); err == nil {
+		t.Fatal("expected second reload to fail")
+	}
+
+	state.mu.Lock()
+	current := state.current
+	state.mu.Unlock()
+
+	if current != first {
+		t.Fatalf("failed reload replaced the current provider: got %v, want %v", current, first)
+	}
+	for _, entry := range order {
+		if entry == "close:gen1" {
+			t.Fatal("previous provider was closed despite the reload failing")
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ProviderRegistry watches a provider's backing configuration file and
+// triggers a Reload whenever it changes, so administrators can swap a
+// provider's parameters - e.g. an S3 bucket or a Redis endpoint - without
+// dropping connections or restarting the broker.
+type ProviderRegistry struct {
+	path     string
+	config   *ProviderConfig
+	onReload func(Provider, error)
+	watcher  *fsnotify.Watcher
+	closeCh  chan struct{}
+}
+
+// NewProviderRegistry starts watching path for changes to cfg's provider
+// configuration. Every time the file is written, it is re-read, cfg.Config
+// is refreshed and cfg.Reload() is called, with the result passed to
+// onReload.
+func NewProviderRegistry(path string, cfg *ProviderConfig, onReload func(Provider, error)) (*ProviderRegistry, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch the containing directory rather than the file itself, since
+	// editors and config-management tools commonly replace files instead
+	// of writing to them in place.
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	r := &ProviderRegistry{
+		path:     path,
+		config:   cfg,
+		onReload: onReload,
+		watcher:  watcher,
+		closeCh:  make(chan struct{}),
+	}
+	go r.run()
+	return r, nil
+}
+
+func (r *ProviderRegistry) run() {
+	for {
+		select {
+		case <-r.closeCh:
+			return
+
+		case event, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(event.Name) != filepath.Clean(r.path) {
+				continue
+			}
+			if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			r.reload()
+
+		case _, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// reload re-reads the watched file into the live ProviderConfig and
+// rebuilds the provider.
+func (r *ProviderRegistry) reload() {
+	var next ProviderConfig
+	b, err := ioutil.ReadFile(r.path)
+	if err == nil {
+		err = unmarshal(b, &next, formatOf(r.path))
+	}
+	if err != nil {
+		r.onReload(nil, err)
+		return
+	}
+
+	state := r.config.ensureState()
+	state.mu.Lock()
+	r.config.Config = next.Config
+	state.mu.Unlock()
+
+	provider, err := r.config.Reload()
+	r.onReload(provider, err)
+}
+
+// Close stops watching for changes.
+func (r *ProviderRegistry) Close() error {
+	close(r.closeCh)
+	return r.watcher.Close()
+}
@@ -0,0 +1,183 @@
+package config
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// LoadOrCreate loads a certificate from the configured paths, generating a
+// self-signed ECDSA P-256 CA and leaf pair on first boot if neither the
+// certificate nor the private key exist yet. If either path is left unset,
+// it defaults to broker.crt/broker.key in the working directory, the same
+// filenames Load falls back to for inline certificates.
+func (c *TLSConfig) LoadOrCreate() (tls.Certificate, error) {
+	if c.Certificate == "" {
+		c.Certificate = "broker.crt"
+	}
+	if c.PrivateKey == "" {
+		c.PrivateKey = "broker.key"
+	}
+
+	_, certErr := os.Stat(c.Certificate)
+	_, keyErr := os.Stat(c.PrivateKey)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		if err := c.generateSelfSigned(); err != nil {
+			return tls.Certificate{}, err
+		}
+	}
+
+	c.Certificate, _ = filepath.Abs(c.Certificate)
+	c.PrivateKey, _ = filepath.Abs(c.PrivateKey)
+	return tls.LoadX509KeyPair(c.Certificate, c.PrivateKey)
+}
+
+// generateSelfSigned creates a self-signed CA and a leaf certificate issued
+// from it, with SANs derived from ListenAddr and the local hostname, and
+// writes both the leaf key and the leaf+CA chain to disk with 0600 perms.
+func (c *TLSConfig) generateSelfSigned() error {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "emitter self-signed CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	leafTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(2),
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	if host != "" {
+		leafTemplate.DNSNames = append(leafTemplate.DNSNames, host)
+	}
+	if ip := listenAddrIP(c.ListenAddr); ip != nil {
+		leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, caCert, &leafKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(leafKey)
+	if err != nil {
+		return err
+	}
+
+	chain := append(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})...)
+	if err := ioutil.WriteFile(c.Certificate, chain, 0600); err != nil {
+		return err
+	}
+
+	key := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return ioutil.WriteFile(c.PrivateKey, key, 0600)
+}
+
+// listenAddrIP extracts the IP address component of a "host:port" listen
+// address, returning nil if the host portion isn't a literal IP.
+func listenAddrIP(listenAddr string) net.IP {
+	host, _, err := net.SplitHostPort(listenAddr)
+	if err != nil {
+		host = listenAddr
+	}
+	return net.ParseIP(host)
+}
+
+// EnsureIdentity assigns a stable NodeName when one hasn't been configured
+// explicitly. It first consults a node.id file persisted in dir,
+// falling back to deriving one from the leaf certificate's public key (so
+// identity survives IP changes) and persisting it for next time.
+func (c *ClusterConfig) EnsureIdentity(cert tls.Certificate, dir string) error {
+	if c.NodeName != "" {
+		return nil
+	}
+
+	idPath := filepath.Join(dir, "node.id")
+	if b, err := ioutil.ReadFile(idPath); err == nil {
+		c.NodeName = strings.TrimSpace(string(b))
+		return nil
+	}
+
+	if len(cert.Certificate) == 0 {
+		return errors.New("config: no certificate available to derive a node identity from")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+	c.NodeName = hex.EncodeToString(sum[:])[:16]
+	return ioutil.WriteFile(idPath, []byte(c.NodeName), 0600)
+}
+
+// tlsProvisioner is implemented by Config types that expose their TLS
+// configuration, letting ReadOrCreate auto-provision a certificate.
+type tlsProvisioner interface {
+	TLS() *TLSConfig
+}
+
+// clusterProvisioner is implemented by Config types that expose their
+// cluster configuration, letting ReadOrCreate derive a stable node identity.
+type clusterProvisioner interface {
+	Cluster() *ClusterConfig
+}
+
+// autoProvisionEnabled reports whether first-boot TLS and cluster identity
+// provisioning is opted into, via the EMITTER_AUTO_PROVISION environment
+// variable. This keeps existing deployments, which manage their own
+// certificates and node names, unaffected.
+func autoProvisionEnabled() bool {
+	switch strings.ToLower(os.Getenv("EMITTER_AUTO_PROVISION")) {
+	case "", "0", "false":
+		return false
+	default:
+		return true
+	}
+}
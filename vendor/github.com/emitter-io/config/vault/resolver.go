@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/emitter-io/config"
+)
+
+func init() {
+	config.RegisterResolver(&Resolver{})
+}
+
+// Resolver is a config.SchemeResolver for "vault://<mount>/<path>" URIs, e.g.
+// "vault://secret/emitter/license". It authenticates lazily against the
+// address in the VAULT_ADDR environment variable, since resolvers are
+// registered before any broker configuration has been read.
+type Resolver struct {
+	once  sync.Once
+	store *VaultStore
+	err   error
+}
+
+// Scheme returns "vault".
+func (r *Resolver) Scheme() string { return "vault" }
+
+// Resolve looks up a "vault://<mount>/<path>" URI in Vault, returning the
+// secret's "value" field.
+func (r *Resolver) Resolve(uri string) (string, bool, error) {
+	r.once.Do(r.connect)
+	if r.err != nil {
+		return "", false, r.err
+	}
+
+	mount, path, err := splitMountPath(uri)
+	if err != nil {
+		return "", false, err
+	}
+
+	v, ok := r.store.readSecret(mount, path)
+	return v, ok, nil
+}
+
+func (r *Resolver) connect() {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		r.err = errors.New("vault: VAULT_ADDR must be set to resolve vault:// URIs")
+		return
+	}
+
+	r.store = New()
+	r.store.addr = strings.TrimRight(addr, "/")
+	if r.err = r.store.login(); r.err == nil {
+		go r.store.renewLoop()
+	}
+}
+
+// splitMountPath splits a "vault://<mount>/<path>" URI into its mount and
+// path components.
+func splitMountPath(uri string) (mount, path string, err error) {
+	raw := strings.TrimPrefix(uri, "vault://")
+	parts := strings.SplitN(raw, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", errors.New("vault: malformed uri '" + uri + "', expected vault://<mount>/<path>")
+	}
+	return parts[0], parts[1], nil
+}
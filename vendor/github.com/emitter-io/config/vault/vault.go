@@ -0,0 +1,246 @@
+// Package vault provides a config.SecretStore implementation backed by a
+// HashiCorp Vault KV v2 secrets engine.
+package vault
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emitter-io/config"
+)
+
+func init() {
+	config.RegisterVaultStore(func(vc *config.VaultConfig) config.SecretStore {
+		return New()
+	})
+}
+
+const (
+	renewInterval = 30 * time.Second
+	renewWindow   = 60 // seconds of remaining lease life that triggers a renewal
+)
+
+// VaultStore is a config.SecretStore which resolves secrets from a HashiCorp Vault
+// KV v2 mount. Paths produced by declassifyRecursive (prefix + "/" + field) are
+// looked up under "secret/data/<prefix-path>".
+type VaultStore struct {
+	client *http.Client
+	addr   string
+	app    string
+
+	mu      sync.RWMutex
+	token   string
+	expires time.Time
+	closeCh chan struct{}
+	once    sync.Once
+}
+
+// New creates a new, unconfigured VaultStore.
+func New() *VaultStore {
+	return &VaultStore{
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{}},
+		},
+		closeCh: make(chan struct{}),
+	}
+}
+
+// Configure configures the store from the broker configuration and logs in to Vault.
+func (s *VaultStore) Configure(cfg config.Config) error {
+	vc := cfg.Vault()
+	if vc == nil || vc.Address == "" {
+		return errors.New("vault: no address configured")
+	}
+
+	s.addr = strings.TrimRight(vc.Address, "/")
+	s.app = vc.Application
+
+	if err := s.login(); err != nil {
+		return err
+	}
+
+	go s.renewLoop()
+	return nil
+}
+
+// defaultMount is the KV v2 mount used by GetSecret, whose paths are always
+// rooted at the "secret" mount per declassifyRecursive's prefix convention.
+const defaultMount = "secret"
+
+// GetSecret resolves a secret path to its value. It returns false whenever the
+// path is missing or the request otherwise fails, so that declassification can
+// gracefully fall through to the next store.
+func (s *VaultStore) GetSecret(secretName string) (string, bool) {
+	return s.readSecret(defaultMount, strings.TrimPrefix(secretName, "/"))
+}
+
+// readSecret fetches the "value" field of a KV v2 secret at mount/path.
+func (s *VaultStore) readSecret(mount, path string) (string, bool) {
+	data, err := s.read(mount + "/data/" + path)
+	if err != nil {
+		return "", false
+	}
+
+	// KV v2 responses wrap the secret fields one level deeper than KV v1:
+	// {"data": {"data": {...fields...}, "metadata": {...}}}.
+	outer, ok := data["data"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	inner, ok := outer["data"].(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+
+	v, ok := inner["value"]
+	if !ok {
+		return "", false
+	}
+
+	value, ok := v.(string)
+	return value, ok
+}
+
+// Close stops the background token-renewal goroutine.
+func (s *VaultStore) Close() error {
+	s.once.Do(func() { close(s.closeCh) })
+	return nil
+}
+
+// login authenticates against Vault using a static VAULT_TOKEN if set, otherwise an
+// AppRole login if VAULT_ROLE_ID is set (with VAULT_SECRET_ID as its secret), or
+// falls back to the legacy App ID auth method using the configured application ID.
+func (s *VaultStore) login() error {
+	if token := os.Getenv("VAULT_TOKEN"); token != "" {
+		s.mu.Lock()
+		s.token = token
+		s.mu.Unlock()
+		return nil
+	}
+
+	if roleID := os.Getenv("VAULT_ROLE_ID"); roleID != "" {
+		resp, err := s.request("POST", "auth/approle/login", map[string]interface{}{
+			"role_id":   roleID,
+			"secret_id": os.Getenv("VAULT_SECRET_ID"),
+		})
+		if err != nil {
+			return err
+		}
+		return s.storeAuth(resp)
+	}
+
+	resp, err := s.request("POST", "auth/app-id/login", map[string]interface{}{
+		"app_id":  s.app,
+		"user_id": os.Getenv("VAULT_USER_ID"),
+	})
+	if err != nil {
+		return err
+	}
+	return s.storeAuth(resp)
+}
+
+func (s *VaultStore) storeAuth(resp map[string]interface{}) error {
+	auth, ok := resp["auth"].(map[string]interface{})
+	if !ok {
+		return errors.New("vault: login response did not contain auth data")
+	}
+
+	token, ok := auth["client_token"].(string)
+	if !ok || token == "" {
+		return errors.New("vault: login response did not contain a client token")
+	}
+
+	lease, _ := auth["lease_duration"].(float64)
+
+	s.mu.Lock()
+	s.token = token
+	if lease > 0 {
+		s.expires = time.Now().Add(time.Duration(lease) * time.Second)
+	} else {
+		s.expires = time.Time{}
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+// renewLoop periodically renews the current token until the store is closed.
+func (s *VaultStore) renewLoop() {
+	ticker := time.NewTicker(renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.closeCh:
+			return
+		case <-ticker.C:
+			s.mu.RLock()
+			expires := s.expires
+			s.mu.RUnlock()
+			if expires.IsZero() || time.Until(expires) > renewWindow*time.Second {
+				continue
+			}
+
+			resp, err := s.request("POST", "auth/token/renew-self", nil)
+			if err == nil {
+				s.storeAuth(resp)
+			}
+		}
+	}
+}
+
+func (s *VaultStore) read(path string) (map[string]interface{}, error) {
+	return s.request("GET", "v1/"+path, nil)
+}
+
+// request issues an authenticated call against the Vault HTTP API.
+func (s *VaultStore) request(method, path string, payload interface{}) (map[string]interface{}, error) {
+	var body *bytes.Reader
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(b)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, s.addr+"/"+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	s.mu.RLock()
+	token := s.token
+	s.mu.RUnlock()
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("vault: request to %s failed with status %d", path, resp.StatusCode)
+	}
+
+	var result map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}